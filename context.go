@@ -0,0 +1,203 @@
+// Copyright 2020 Kentaro Hibino. All rights reserved.
+// Use of this source code is governed by a MIT license
+// that can be found in the LICENSE file.
+
+package asynq
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/hibiken/asynq/internal/base"
+)
+
+// A taskMetadata holds task scoped data to put into a context.
+type taskMetadata struct {
+	id         string
+	maxRetry   int
+	retryCount int
+	qname      string
+	enqueuedAt time.Time
+	lease      *base.Lease
+}
+
+// centinel values to indicate no timeout or deadline set on the task message.
+var noTimeout = time.Duration(0)
+var noDeadline = time.Time{}
+
+func createContext(msg *base.TaskMessage) (context.Context, context.CancelFunc) {
+	metadata := taskMetadata{
+		id:         msg.ID.String(),
+		maxRetry:   msg.Retry,
+		retryCount: msg.Retried,
+		qname:      msg.Queue,
+	}
+	if msg.EnqueuedAt != 0 {
+		metadata.enqueuedAt = time.Unix(msg.EnqueuedAt, 0)
+	}
+	timeout, err := time.ParseDuration(msg.Timeout)
+	if err != nil {
+		timeout = noTimeout // zero value indicates no timeout
+	}
+	deadline, err := time.Parse(time.RFC3339, msg.Deadline)
+	if err != nil {
+		deadline = noDeadline // zero value indicates no deadline
+	}
+	if timeout == noTimeout && deadline.Equal(noDeadline) {
+		// If neither timeout nor deadline are set, use a context that's
+		// only cancelled explicitly (e.g. on shutdown). There's no lease to
+		// extend in this case.
+		ctx := context.WithValue(context.Background(), metadataCtxKey{}, metadata)
+		return context.WithCancel(ctx)
+	}
+	d := deadline
+	if timeout != noTimeout && (deadline.Equal(noDeadline) || time.Now().Add(timeout).Before(deadline)) {
+		d = time.Now().Add(timeout)
+	}
+	// Use a lease to track the effective deadline so that ExtendDeadline and
+	// Heartbeat can push it out from within the handler without replacing
+	// the context itself.
+	metadata.lease = base.NewLease(d)
+	ctx := context.WithValue(context.Background(), metadataCtxKey{}, metadata)
+	cctx, cancel := context.WithCancel(ctx)
+	lctx := &leaseDeadlineContext{Context: cctx, lease: metadata.lease}
+	go watchLease(cctx, metadata.lease, cancel)
+	return lctx, cancel
+}
+
+// leaseDeadlineContext reports a mutable deadline backed by a base.Lease,
+// while delegating Done/Err/Value to the wrapped context.
+type leaseDeadlineContext struct {
+	context.Context
+	lease *base.Lease
+}
+
+func (c *leaseDeadlineContext) Deadline() (deadline time.Time, ok bool) {
+	return c.lease.Deadline(), true
+}
+
+// watchLease waits for the lease to expire and cancels the context
+// accordingly. Each time the deadline it last saw passes, it checks the
+// lease again and, if the lease was extended meanwhile, waits for the new
+// deadline instead, so it never fires cancel early.
+func watchLease(ctx context.Context, lease *base.Lease, cancel context.CancelFunc) {
+	timer := time.NewTimer(time.Until(lease.Deadline()))
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-timer.C:
+			if lease.IsExpired() {
+				cancel()
+				return
+			}
+			timer.Reset(time.Until(lease.Deadline()))
+		}
+	}
+}
+
+type metadataCtxKey struct{}
+
+// GetTaskID extracts a task ID from a context, if any.
+//
+// Task ID is guaranteed to be unique for the lifetime of the task.
+func GetTaskID(ctx context.Context) (id string, ok bool) {
+	metadata, ok := ctx.Value(metadataCtxKey{}).(taskMetadata)
+	if !ok {
+		return "", false
+	}
+	return metadata.id, true
+}
+
+// GetRetryCount extracts retry count from a context, if any.
+//
+// Return value indicates the number of times associated task has been
+// retried so far.
+func GetRetryCount(ctx context.Context) (n int, ok bool) {
+	metadata, ok := ctx.Value(metadataCtxKey{}).(taskMetadata)
+	if !ok {
+		return 0, false
+	}
+	return metadata.retryCount, true
+}
+
+// GetMaxRetry extracts maximum retry from a context, if any.
+//
+// Return value indicates the maximum number of times the associated task
+// can be retried if it fails.
+func GetMaxRetry(ctx context.Context) (n int, ok bool) {
+	metadata, ok := ctx.Value(metadataCtxKey{}).(taskMetadata)
+	if !ok {
+		return 0, false
+	}
+	return metadata.maxRetry, true
+}
+
+// GetQueueName extracts queue name from a context, if any.
+//
+// Return value indicates which queue the associated task was enqueued to.
+func GetQueueName(ctx context.Context) (qname string, ok bool) {
+	metadata, ok := ctx.Value(metadataCtxKey{}).(taskMetadata)
+	if !ok {
+		return "", false
+	}
+	return metadata.qname, true
+}
+
+// GetEnqueuedAt extracts the enqueue time from a context, if any.
+//
+// Return value indicates when the associated task was enqueued.
+func GetEnqueuedAt(ctx context.Context) (t time.Time, ok bool) {
+	metadata, ok := ctx.Value(metadataCtxKey{}).(taskMetadata)
+	if !ok {
+		return time.Time{}, false
+	}
+	return metadata.enqueuedAt, true
+}
+
+// ExtendDeadline sets the task's effective processing deadline to d from
+// now, so a long-running handler can keep working past the deadline it was
+// dequeued with instead of ctx being cancelled. If d is shorter than the
+// time left, ctx.Deadline reports the earlier time, but ctx is not cancelled
+// before the deadline that was in force at the time of the call.
+//
+// NOTE: this extends only the in-process context deadline tracked by ctx.
+// It does not touch a server-side lease record, so on its own it does not
+// stop the task from being treated as orphaned and re-delivered.
+//
+// It returns an error if ctx carries no lease (e.g. the task has neither a
+// timeout nor a deadline set) or if the lease has already expired.
+func ExtendDeadline(ctx context.Context, d time.Duration) error {
+	metadata, ok := ctx.Value(metadataCtxKey{}).(taskMetadata)
+	if !ok || metadata.lease == nil {
+		return fmt.Errorf("asynq: cannot extend deadline: no lease associated with context")
+	}
+	if !metadata.lease.Reset(time.Now().Add(d)) {
+		return fmt.Errorf("asynq: cannot extend deadline: lease has already expired")
+	}
+	return nil
+}
+
+// Heartbeat resets the task's lease to expire its original TTL (the timeout
+// or time-to-deadline the task was dequeued with) from now, signaling that
+// the handler is still actively working on it.
+//
+// NOTE: like ExtendDeadline, this only extends the in-process context
+// deadline tracked by ctx; it does not refresh a server-side lease record,
+// so on its own it does not stop the processor from re-delivering the task
+// as orphaned. See ExtendDeadline's doc comment for the same caveat.
+//
+// It returns an error if ctx carries no lease or if the lease has already
+// expired.
+func Heartbeat(ctx context.Context) error {
+	metadata, ok := ctx.Value(metadataCtxKey{}).(taskMetadata)
+	if !ok || metadata.lease == nil {
+		return fmt.Errorf("asynq: cannot send heartbeat: no lease associated with context")
+	}
+	if !metadata.lease.Extend() {
+		return fmt.Errorf("asynq: cannot send heartbeat: lease has already expired")
+	}
+	return nil
+}
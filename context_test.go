@@ -67,6 +67,120 @@ func TestCreateContextWithTimeRestrictions(t *testing.T) {
 	}
 }
 
+func TestExtendDeadline(t *testing.T) {
+	msg := &base.TaskMessage{
+		Type:     "something",
+		ID:       xid.New(),
+		Timeout:  (10 * time.Second).String(),
+		Deadline: time.Time{}.Format(time.RFC3339),
+	}
+
+	ctx, cancel := createContext(msg)
+	defer cancel()
+
+	if err := ExtendDeadline(ctx, 20*time.Second); err != nil {
+		t.Fatalf("ExtendDeadline returned error: %v", err)
+	}
+
+	got, ok := ctx.Deadline()
+	if !ok {
+		t.Fatal("ctx.Deadline() returned false, want deadline to be set")
+	}
+	want := time.Now().Add(20 * time.Second)
+	if !cmp.Equal(want, got, cmpopts.EquateApproxTime(time.Second)) {
+		t.Errorf("after ExtendDeadline, ctx.Deadline() returned %v, want %v", got, want)
+	}
+
+	if err := Heartbeat(ctx); err != nil {
+		t.Errorf("Heartbeat returned error: %v", err)
+	}
+}
+
+func TestHeartbeatExtendsLease(t *testing.T) {
+	ttl := 100 * time.Millisecond
+	msg := &base.TaskMessage{
+		Type:     "something",
+		ID:       xid.New(),
+		Timeout:  ttl.String(),
+		Deadline: time.Time{}.Format(time.RFC3339),
+	}
+
+	ctx, cancel := createContext(msg)
+	defer cancel()
+
+	originalDeadline, ok := ctx.Deadline()
+	if !ok {
+		t.Fatal("ctx.Deadline() returned false, want deadline to be set")
+	}
+
+	// Heartbeat repeatedly, each time before the lease would otherwise
+	// expire, well past the task's original deadline.
+	for i := 0; i < 3; i++ {
+		time.Sleep(ttl / 2)
+		if err := Heartbeat(ctx); err != nil {
+			t.Fatalf("Heartbeat returned error: %v", err)
+		}
+	}
+
+	got, ok := ctx.Deadline()
+	if !ok {
+		t.Fatal("ctx.Deadline() returned false after Heartbeat, want deadline to be set")
+	}
+	if !got.After(originalDeadline) {
+		t.Errorf("after Heartbeat, ctx.Deadline() == %v, want it to be after the original deadline %v", got, originalDeadline)
+	}
+	want := time.Now().Add(ttl)
+	if !cmp.Equal(want, got, cmpopts.EquateApproxTime(50*time.Millisecond)) {
+		t.Errorf("after Heartbeat, ctx.Deadline() returned %v, want ~%v", got, want)
+	}
+
+	select {
+	case <-ctx.Done():
+		t.Error("ctx.Done() fired even though Heartbeat kept the lease alive past the original deadline")
+	default:
+	}
+}
+
+func TestExtendDeadlineAfterExpiration(t *testing.T) {
+	msg := &base.TaskMessage{
+		Type:     "something",
+		ID:       xid.New(),
+		Timeout:  (10 * time.Millisecond).String(),
+		Deadline: time.Time{}.Format(time.RFC3339),
+	}
+
+	ctx, cancel := createContext(msg)
+	defer cancel()
+
+	<-time.After(20 * time.Millisecond)
+
+	if err := ExtendDeadline(ctx, time.Minute); err == nil {
+		t.Error("ExtendDeadline returned nil error after the lease expired, want error")
+	}
+	if err := Heartbeat(ctx); err == nil {
+		t.Error("Heartbeat returned nil error after the lease expired, want error")
+	}
+}
+
+func TestExtendDeadlineWithoutLease(t *testing.T) {
+	msg := &base.TaskMessage{
+		Type:     "something",
+		ID:       xid.New(),
+		Timeout:  time.Duration(0).String(),
+		Deadline: time.Time{}.Format(time.RFC3339),
+	}
+
+	ctx, cancel := createContext(msg)
+	defer cancel()
+
+	if err := ExtendDeadline(ctx, time.Minute); err == nil {
+		t.Error("ExtendDeadline returned nil error for a context without a lease, want error")
+	}
+	if err := Heartbeat(ctx); err == nil {
+		t.Error("Heartbeat returned nil error for a context without a lease, want error")
+	}
+}
+
 func TestCreateContextWithoutTimeRestrictions(t *testing.T) {
 	msg := &base.TaskMessage{
 		Type:     "something",
@@ -98,12 +212,14 @@ func TestCreateContextWithoutTimeRestrictions(t *testing.T) {
 }
 
 func TestGetTaskMetadataFromContext(t *testing.T) {
+	now := time.Now()
+
 	tests := []struct {
 		desc string
 		msg  *base.TaskMessage
 	}{
-		{"with zero retried message", &base.TaskMessage{Type: "something", ID: xid.New(), Retry: 25, Retried: 0}},
-		{"with non-zero retried message", &base.TaskMessage{Type: "something", ID: xid.New(), Retry: 10, Retried: 5}},
+		{"with zero retried message", &base.TaskMessage{Type: "something", ID: xid.New(), Retry: 25, Retried: 0, Queue: "default", EnqueuedAt: now.Unix()}},
+		{"with non-zero retried message", &base.TaskMessage{Type: "something", ID: xid.New(), Retry: 10, Retried: 5, Queue: "critical", EnqueuedAt: now.Unix()}},
 	}
 
 	for _, tc := range tests {
@@ -132,6 +248,22 @@ func TestGetTaskMetadataFromContext(t *testing.T) {
 		if ok && maxRetry != tc.msg.Retry {
 			t.Errorf("%s: GetMaxRetry(ctx) returned n == %d want %d", tc.desc, maxRetry, tc.msg.Retry)
 		}
+
+		qname, ok := GetQueueName(ctx)
+		if !ok {
+			t.Errorf("%s: GetQueueName(ctx) returned ok == false", tc.desc)
+		}
+		if ok && qname != tc.msg.Queue {
+			t.Errorf("%s: GetQueueName(ctx) returned qname == %q, want %q", tc.desc, qname, tc.msg.Queue)
+		}
+
+		enqueuedAt, ok := GetEnqueuedAt(ctx)
+		if !ok {
+			t.Errorf("%s: GetEnqueuedAt(ctx) returned ok == false", tc.desc)
+		}
+		if ok && !cmp.Equal(time.Unix(tc.msg.EnqueuedAt, 0), enqueuedAt) {
+			t.Errorf("%s: GetEnqueuedAt(ctx) returned t == %v, want %v", tc.desc, enqueuedAt, time.Unix(tc.msg.EnqueuedAt, 0))
+		}
 	}
 }
 
@@ -153,5 +285,11 @@ func TestGetTaskMetadataFromContextError(t *testing.T) {
 		if _, ok := GetMaxRetry(tc.ctx); ok {
 			t.Errorf("%s: GetMaxRetry(ctx) returned ok == true", tc.desc)
 		}
+		if _, ok := GetQueueName(tc.ctx); ok {
+			t.Errorf("%s: GetQueueName(ctx) returned ok == true", tc.desc)
+		}
+		if _, ok := GetEnqueuedAt(tc.ctx); ok {
+			t.Errorf("%s: GetEnqueuedAt(ctx) returned ok == true", tc.desc)
+		}
 	}
 }
@@ -0,0 +1,53 @@
+// Copyright 2020 Kentaro Hibino. All rights reserved.
+// Use of this source code is governed by a MIT license
+// that can be found in the LICENSE file.
+
+// Package base defines foundational types and constants used in asynq package.
+package base
+
+import (
+	"github.com/rs/xid"
+)
+
+// TaskMessage is the internal representation of a task with additional metadata fields.
+// Serialized data of this type is used to communicate across the stack, client to server, to workers, etc.
+type TaskMessage struct {
+	// Type indicates the kind of the task to be performed.
+	Type string
+
+	// Payload holds data needed to process the task.
+	Payload []byte
+
+	// ID is a unique identifier for each task.
+	ID xid.ID
+
+	// Queue is a name this message should be enqueued to.
+	Queue string
+
+	// Retry is the max number of retry for this task.
+	Retry int
+
+	// Retried is the number of times we've retried this task so far.
+	Retried int
+
+	// ErrorMsg holds the error message from the last failure.
+	ErrorMsg string
+
+	// Timeout specifies the timeout as a duration string in the format
+	// accepted by time.ParseDuration (e.g. "30s").
+	// If task processing doesn't complete within the timeout, the task will be retried
+	// if retry count is remaining. Otherwise, task will be moved to the archive.
+	//
+	// Use zero to indicate no timeout.
+	Timeout string
+
+	// Deadline specifies the deadline for the task in RFC3339 format.
+	// If task processing doesn't complete before the deadline, the task will be retried
+	// if retry count is remaining. Otherwise, task will be moved to the archive.
+	//
+	// Use zero to indicate no deadline.
+	Deadline string
+
+	// EnqueuedAt is the time the task was enqueued in Unix time.
+	EnqueuedAt int64
+}
@@ -0,0 +1,66 @@
+// Copyright 2020 Kentaro Hibino. All rights reserved.
+// Use of this source code is governed by a MIT license
+// that can be found in the LICENSE file.
+
+package base
+
+import (
+	"sync"
+	"time"
+)
+
+// Lease is a time bound lease for a worker to process a task.
+//
+// It tracks the deadline by which the task must either complete or have its
+// lease extended.
+type Lease struct {
+	ttl time.Duration // duration from creation to the initial expiration; Reset does not change it
+
+	mu       sync.Mutex
+	expireAt time.Time // guarded by mu
+}
+
+// NewLease returns a new Lease that expires at expirationTime.
+func NewLease(expirationTime time.Time) *Lease {
+	return &Lease{
+		ttl:      time.Until(expirationTime),
+		expireAt: expirationTime,
+	}
+}
+
+// Reset changes the lease to expire at expirationTime.
+//
+// It returns true if the lease was still valid at the time of the call and
+// the reset succeeded, or false if the lease had already expired.
+func (l *Lease) Reset(expirationTime time.Time) bool {
+	if l.IsExpired() {
+		return false
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.expireAt = expirationTime
+	return true
+}
+
+// Extend resets the lease to expire ttl (the duration from the lease's
+// creation to its initial expiration) from now.
+//
+// It returns true if the lease was still valid at the time of the call and
+// the extension succeeded, or false if the lease had already expired.
+func (l *Lease) Extend() bool {
+	return l.Reset(time.Now().Add(l.ttl))
+}
+
+// Deadline returns the time at which the lease expires.
+func (l *Lease) Deadline() time.Time {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.expireAt
+}
+
+// IsExpired reports whether the lease has expired.
+func (l *Lease) IsExpired() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return time.Now().After(l.expireAt)
+}